@@ -5,19 +5,15 @@ package magicstring
 
 import (
 	"reflect"
-	"runtime"
 	"unsafe"
 )
 
 // Attach associates a newly allocated string with data.
 // The value of the returned string is guaranteed to be identical to str.
 //
-// Calling `Attach(str, nil)` is equivalent to `Detach(str)`.
+// A nil data is a kind of data: Attach(str, nil) still returns a magic
+// string, for which Is reports true. Use Detach to strip an attachment.
 func Attach(str string, data interface{}) string {
-	if data == nil {
-		return Detach(str)
-	}
-
 	sz := len(str)
 
 	if sz == 0 {
@@ -33,39 +29,61 @@ func Attach(str string, data interface{}) string {
 
 // attachEmptyString allocates a new holder for empty string.
 func attachEmptyString(data interface{}) string {
-	payload := &magicStringPayload{}
-	payload.checksum = makeChecksum(uintptr(unsafe.Pointer(payload)))
-	payload.data = data
-	dst := (*[sizeofPayload]byte)(unsafe.Pointer(payload))[0:0:0]
-	return *(*string)(unsafe.Pointer(&dst))
+	payload, out := newEmptyStringPayload()
+	payload.storeData(data)
+	return out
 }
 
 // attachSmallString allocates a new holder type to hold both string content and data.
 func attachSmallString(str string, data interface{}) string {
+	payload, out := newSmallStringPayload(str)
+	payload.storeData(data)
+	return out
+}
+
+// attachLargeString allocates new memory to hold both string content and
+// magic string payload. The data is referenced by string's finalizer.
+func attachLargeString(str string, data interface{}) string {
+	payload, out := newLargeStringPayload(str)
+	payload.storeData(data)
+	pin(payload)
+	return out
+}
+
+// newEmptyStringPayload allocates a new holder for an empty string without
+// assigning any data to it. Callers are expected to fill in the payload
+// themselves.
+func newEmptyStringPayload() (payload *magicStringPayload, out string) {
+	payload = &magicStringPayload{}
+	payload.checksum = makeChecksum(uintptr(unsafe.Pointer(payload)))
+	dst := (*[sizeofPayload]byte)(unsafe.Pointer(payload))[0:0:0]
+	return payload, *(*string)(unsafe.Pointer(&dst))
+}
+
+// newSmallStringPayload allocates a new holder type to hold str's content
+// without assigning any data to it. Callers are expected to fill in the
+// payload themselves.
+func newSmallStringPayload(str string) (payload *magicStringPayload, out string) {
 	sz := len(str)
 	payload, dst := newPayload(sz)
 	copy(dst, str)
 	payload.checksum = makeChecksum(uintptr(unsafe.Pointer(&dst[0])))
-	payload.data = data
-	return *(*string)(unsafe.Pointer(&dst))
+	return payload, *(*string)(unsafe.Pointer(&dst))
 }
 
-// attachLargeString allocates new memory to hold both string content and
-// magic string payload. The data is referenced by string's finalizer.
-func attachLargeString(str string, data interface{}) string {
+// newLargeStringPayload allocates new memory to hold both str's content and
+// magic string payload, without assigning any data to it. Callers are
+// expected to fill in the payload and, if it holds any reference type,
+// arrange for it to be kept alive with runtime.SetFinalizer, as this memory
+// is opaque to the garbage collector.
+func newLargeStringPayload(str string) (payload *magicStringPayload, out string) {
 	holder := make([]byte, len(str)+int(sizeofPayload))
-	payload := (*magicStringPayload)(unsafe.Pointer(&holder[0]))
+	payload = (*magicStringPayload)(unsafe.Pointer(&holder[0]))
 	dst := holder[sizeofPayload:]
 
 	payload.checksum = makeChecksum(uintptr(unsafe.Pointer(&dst[0])))
-	payload.data = data
 	copy(dst, str)
-
-	runtime.SetFinalizer(payload, func(payload *magicStringPayload) {
-		// Hold data in this finalizer and clear it after finalized.
-		data = nil
-	})
-	return *(*string)(unsafe.Pointer(&dst))
+	return payload, *(*string)(unsafe.Pointer(&dst))
 }
 
 // Read reads the attached data inside the str.
@@ -77,7 +95,7 @@ func Read(str string) interface{} {
 		return nil
 	}
 
-	return payload.data
+	return payload.loadData()
 }
 
 // Is checks if there is any data attached to str.
@@ -0,0 +1,191 @@
+// Copyright 2022 Huan Du. All rights reserved.
+// Licensed under the MIT license that can be found in the LICENSE file.
+
+package magicstring
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// magicHeader marks the start of data produced by Marshal, so Unmarshal can
+// fail fast on input that was never produced by Marshal.
+var magicHeader = [4]byte{'M', 'S', 'T', '1'}
+
+// Encode turns data attached to a magic string into bytes for a registered
+// codec.
+type Encode func(data interface{}) ([]byte, error)
+
+// Decode turns bytes produced by an Encode back into data.
+type Decode func(b []byte) (interface{}, error)
+
+type codec struct {
+	encode Encode
+	decode Decode
+}
+
+var (
+	codecMu      sync.RWMutex
+	codecs       = map[string]codec{}
+	defaultCodec = "json"
+)
+
+func init() {
+	RegisterCodec("json", func(data interface{}) ([]byte, error) {
+		return json.Marshal(data)
+	}, func(b []byte) (interface{}, error) {
+		var v interface{}
+		err := json.Unmarshal(b, &v)
+		return v, err
+	})
+}
+
+// RegisterCodec registers a named serialization strategy for the data
+// attached to a magic string, for use by Marshal and Unmarshal. Registering
+// a name that's already registered replaces it.
+func RegisterCodec(name string, enc Encode, dec Decode) {
+	codecMu.Lock()
+	defer codecMu.Unlock()
+	codecs[name] = codec{encode: enc, decode: dec}
+}
+
+// SetDefaultCodec sets the codec Marshal uses to encode attached data; it
+// defaults to "json". name must have already been registered with
+// RegisterCodec.
+func SetDefaultCodec(name string) error {
+	codecMu.Lock()
+	defer codecMu.Unlock()
+
+	if _, ok := codecs[name]; !ok {
+		return fmt.Errorf("magicstring: codec %q is not registered", name)
+	}
+
+	defaultCodec = name
+	return nil
+}
+
+// Marshal encodes s and the data attached to it, if any, into a
+// self-describing byte sequence that can be copied or sent across a
+// process boundary and later restored with Unmarshal. A plain
+// `string([]byte(s))` or `fmt.Sprint(s)` cannot do this: the attachment
+// lives in memory right next to s's bytes and is lost the moment they are
+// copied elsewhere.
+//
+// Marshal only transports the primary attachment, the one Attach/Replace
+// set and Read returns. Anything attached through AttachKey is local
+// bookkeeping between independent subsystems sharing s in one process and
+// is not encoded; Unmarshal's result responds to Read but not to
+// ReadKey/Keys for any key s carried before marshaling.
+func Marshal(s string) ([]byte, error) {
+	data := Read(s)
+
+	codecMu.RLock()
+	name := defaultCodec
+	c, ok := codecs[name]
+	codecMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("magicstring: default codec %q is not registered", name)
+	}
+
+	var encoded []byte
+
+	if data != nil {
+		var err error
+
+		encoded, err = c.encode(data)
+
+		if err != nil {
+			return nil, fmt.Errorf("magicstring: failed to encode attached data: %w", err)
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.Write(magicHeader[:])
+	writeLengthPrefixed(&buf, []byte(name))
+	writeLengthPrefixed(&buf, []byte(s))
+	writeLengthPrefixed(&buf, encoded)
+	return buf.Bytes(), nil
+}
+
+// Unmarshal reverses Marshal, reconstructing a fresh magic string with its
+// attached data restored using whichever codec Marshal encoded it with.
+//
+// If s was not a magic string, or the data attached to it was nil, nothing
+// was encoded, and Unmarshal returns an ordinary string for which Is
+// reports false.
+func Unmarshal(b []byte) (string, error) {
+	if len(b) < len(magicHeader) || !bytes.Equal(b[:len(magicHeader)], magicHeader[:]) {
+		return "", errors.New("magicstring: not a value produced by Marshal")
+	}
+
+	b = b[len(magicHeader):]
+
+	name, b, err := readLengthPrefixed(b)
+
+	if err != nil {
+		return "", err
+	}
+
+	body, b, err := readLengthPrefixed(b)
+
+	if err != nil {
+		return "", err
+	}
+
+	encoded, _, err := readLengthPrefixed(b)
+
+	if err != nil {
+		return "", err
+	}
+
+	if len(encoded) == 0 {
+		return string(body), nil
+	}
+
+	codecMu.RLock()
+	c, ok := codecs[string(name)]
+	codecMu.RUnlock()
+
+	if !ok {
+		return "", fmt.Errorf("magicstring: codec %q is not registered", name)
+	}
+
+	data, err := c.decode(encoded)
+
+	if err != nil {
+		return "", fmt.Errorf("magicstring: failed to decode attached data: %w", err)
+	}
+
+	return Attach(string(body), data), nil
+}
+
+// writeLengthPrefixed appends b to buf, preceded by its length as a 4-byte
+// big-endian integer.
+func writeLengthPrefixed(buf *bytes.Buffer, b []byte) {
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(b)))
+	buf.Write(length[:])
+	buf.Write(b)
+}
+
+// readLengthPrefixed reads one writeLengthPrefixed-encoded value off the
+// front of b and returns it along with the remaining, unconsumed bytes.
+func readLengthPrefixed(b []byte) (value, rest []byte, err error) {
+	if len(b) < 4 {
+		return nil, nil, errors.New("magicstring: truncated length prefix")
+	}
+
+	length := binary.BigEndian.Uint32(b)
+	b = b[4:]
+
+	if uint32(len(b)) < length {
+		return nil, nil, errors.New("magicstring: truncated payload")
+	}
+
+	return b[:length], b[length:], nil
+}
@@ -0,0 +1,102 @@
+// Copyright 2022 Huan Du. All rights reserved.
+// Licensed under the MIT license that can be found in the LICENSE file.
+
+package magicstring
+
+import (
+	"bytes"
+	"encoding/gob"
+	"testing"
+
+	"github.com/huandu/go-assert"
+)
+
+func TestMarshalUnmarshalPlainString(t *testing.T) {
+	a := assert.New(t)
+	s := "ordinary string"
+
+	b, err := Marshal(s)
+	a.Assert(err == nil)
+
+	got, err := Unmarshal(b)
+	a.Assert(err == nil)
+	a.Equal(got, s)
+	a.Assert(!Is(got))
+}
+
+func TestMarshalUnmarshalAttachedData(t *testing.T) {
+	a := assert.New(t)
+	s := Attach("magic string", map[string]interface{}{"foo": float64(123)})
+
+	b, err := Marshal(s)
+	a.Assert(err == nil)
+
+	got, err := Unmarshal(b)
+	a.Assert(err == nil)
+	a.Equal(got, "magic string")
+	a.Assert(Is(got))
+	a.Equal(Read(got), Read(s))
+}
+
+// TestMarshalDoesNotTransportKeyedData documents that Marshal only carries
+// the primary attachment: data attached through AttachKey does not survive
+// a Marshal/Unmarshal round trip.
+func TestMarshalDoesNotTransportKeyedData(t *testing.T) {
+	a := assert.New(t)
+	s := Attach("magic string", float64(123))
+	s = AttachKey(s, keyA{}, "foo")
+
+	b, err := Marshal(s)
+	a.Assert(err == nil)
+
+	got, err := Unmarshal(b)
+	a.Assert(err == nil)
+	a.Equal(Read(got), Read(s))
+
+	_, ok := ReadKey(got, keyA{})
+	a.Assert(!ok)
+}
+
+func TestUnmarshalRejectsForeignData(t *testing.T) {
+	a := assert.New(t)
+	_, err := Unmarshal([]byte("not a magic string payload"))
+	a.Assert(err != nil)
+}
+
+type gobValue struct {
+	Foo int
+}
+
+func TestRegisterCodec(t *testing.T) {
+	a := assert.New(t)
+	gob.Register(gobValue{})
+
+	RegisterCodec("gob", func(data interface{}) ([]byte, error) {
+		var buf bytes.Buffer
+		err := gob.NewEncoder(&buf).Encode(&data)
+		return buf.Bytes(), err
+	}, func(b []byte) (interface{}, error) {
+		var data interface{}
+		err := gob.NewDecoder(bytes.NewReader(b)).Decode(&data)
+		return data, err
+	})
+
+	err := SetDefaultCodec("gob")
+	a.Assert(err == nil)
+	defer SetDefaultCodec("json")
+
+	s := Attach("magic string", gobValue{Foo: 123})
+	b, err := Marshal(s)
+	a.Assert(err == nil)
+
+	got, err := Unmarshal(b)
+	a.Assert(err == nil)
+	a.Equal(got, "magic string")
+	a.Equal(Read(got), gobValue{Foo: 123})
+}
+
+func TestSetDefaultCodecUnknown(t *testing.T) {
+	a := assert.New(t)
+	err := SetDefaultCodec("does-not-exist")
+	a.Assert(err != nil)
+}
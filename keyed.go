@@ -0,0 +1,257 @@
+// Copyright 2022 Huan Du. All rights reserved.
+// Licensed under the MIT license that can be found in the LICENSE file.
+
+package magicstring
+
+import "runtime"
+
+// AttachKey associates data with str under key, without disturbing any data
+// already attached to str through Attach or a different key. It lets
+// independent subsystems share one magic string instead of clobbering each
+// other through plain Attach.
+//
+// If str is already a magic string, it's mutated in place and returned
+// unchanged; otherwise a new magic string holding only key/data is
+// allocated and returned, following the same rules as Attach.
+func AttachKey(str string, key interface{}, data interface{}) string {
+	payload := read(str)
+	out := str
+
+	if payload == nil {
+		payload, out = attachPayload(str)
+	}
+
+	payload.setKey(key, data)
+	pin(payload)
+	return out
+}
+
+// ReadKey reads the data attached to str under key.
+// It returns ok == false if str is not a magic string or key was never
+// attached to it.
+func ReadKey(str string, key interface{}) (data interface{}, ok bool) {
+	payload := read(str)
+
+	if payload == nil {
+		return nil, false
+	}
+
+	return payload.getKey(key)
+}
+
+// DeleteKey removes the data attached to str under key.
+// It reports whether key was present.
+func DeleteKey(str string, key interface{}) bool {
+	payload := read(str)
+
+	if payload == nil {
+		return false
+	}
+
+	ok := payload.deleteKey(key)
+
+	if ok {
+		pin(payload)
+	}
+
+	return ok
+}
+
+// Keys returns every key currently attached to str through AttachKey.
+// It returns nil if str is not a magic string.
+func Keys(str string) []interface{} {
+	payload := read(str)
+
+	if payload == nil {
+		return nil
+	}
+
+	return payload.keys()
+}
+
+// attachPayload allocates a new magic string holder for str without
+// assigning payload.data, for use by API that attaches data outside of the
+// data field, such as AttachKey.
+func attachPayload(str string) (payload *magicStringPayload, out string) {
+	sz := len(str)
+
+	switch {
+	case sz == 0:
+		return newEmptyStringPayload()
+	case sz <= smallStringMax:
+		return newSmallStringPayload(str)
+	default:
+		return newLargeStringPayload(str)
+	}
+}
+
+func (p *magicStringPayload) setKey(key, data interface{}) {
+	if p.keyStore == nil {
+		p.keyStore = &keyedStore{}
+	}
+
+	store := p.keyStore
+
+	for i := 0; i < store.kvLen; i++ {
+		if store.kv[i].key == key {
+			store.kv[i].data = data
+			return
+		}
+	}
+
+	if store.kvExtra != nil {
+		if _, ok := store.kvExtra[key]; ok {
+			store.kvExtra[key] = data
+			return
+		}
+	}
+
+	if store.kvLen < len(store.kv) {
+		store.kv[store.kvLen] = keyedData{key: key, data: data}
+		store.kvLen++
+		return
+	}
+
+	if store.kvExtra == nil {
+		store.kvExtra = make(map[interface{}]interface{})
+	}
+
+	store.kvExtra[key] = data
+}
+
+func (p *magicStringPayload) getKey(key interface{}) (data interface{}, ok bool) {
+	if p.keyStore == nil {
+		return nil, false
+	}
+
+	store := p.keyStore
+
+	for i := 0; i < store.kvLen; i++ {
+		if store.kv[i].key == key {
+			return store.kv[i].data, true
+		}
+	}
+
+	if store.kvExtra != nil {
+		data, ok = store.kvExtra[key]
+	}
+
+	return
+}
+
+func (p *magicStringPayload) deleteKey(key interface{}) bool {
+	if p.keyStore == nil {
+		return false
+	}
+
+	store := p.keyStore
+
+	for i := 0; i < store.kvLen; i++ {
+		if store.kv[i].key == key {
+			last := store.kvLen - 1
+			store.kv[i] = store.kv[last]
+			store.kv[last] = keyedData{}
+			store.kvLen--
+			return true
+		}
+	}
+
+	if store.kvExtra != nil {
+		if _, ok := store.kvExtra[key]; ok {
+			delete(store.kvExtra, key)
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *magicStringPayload) keys() []interface{} {
+	if p.keyStore == nil {
+		return nil
+	}
+
+	store := p.keyStore
+	keys := make([]interface{}, 0, store.kvLen+len(store.kvExtra))
+
+	for i := 0; i < store.kvLen; i++ {
+		keys = append(keys, store.kv[i].key)
+	}
+
+	for k := range store.kvExtra {
+		keys = append(keys, k)
+	}
+
+	return keys
+}
+
+// liveValues collects everything currently reachable through payload's
+// fields, so pin can keep all of it alive at once. This must include not
+// just attached values but also the keyedStore itself, its keys, and the
+// kvExtra map it holds: all of it lives only inside payload, which for a
+// large string is carved out of a raw []byte the garbage collector does
+// not scan.
+func (p *magicStringPayload) liveValues() []interface{} {
+	store := p.keyStore
+	kvLen, kvExtraLen := 0, 0
+
+	if store != nil {
+		kvLen, kvExtraLen = store.kvLen, len(store.kvExtra)
+	}
+
+	values := make([]interface{}, 0, 3+2*kvLen+2*kvExtraLen)
+
+	// Keep the boxed *interface{} itself reachable, not just the value it
+	// points to: the box is only referenced through p.data, which is also
+	// invisible to the garbage collector inside a large string's payload.
+	if ptr := p.data.Load(); ptr != nil {
+		values = append(values, ptr)
+	}
+
+	if store == nil {
+		return values
+	}
+
+	// Keep the *keyedStore itself reachable too: p.keyStore is the only
+	// reference to it, and that pointer is just as invisible to the
+	// garbage collector as p.data is.
+	values = append(values, store)
+
+	for i := 0; i < store.kvLen; i++ {
+		values = append(values, store.kv[i].key, store.kv[i].data)
+	}
+
+	if store.kvExtra != nil {
+		values = append(values, store.kvExtra)
+
+		for k, v := range store.kvExtra {
+			values = append(values, k, v)
+		}
+	}
+
+	return values
+}
+
+// pin (re-)installs a finalizer on payload that keeps every value currently
+// attached to it reachable to the garbage collector. This is required
+// because a large magic string's payload is carved out of a raw []byte,
+// which the garbage collector does not scan for pointers, so nothing would
+// otherwise keep an attached reference type alive.
+func pin(payload *magicStringPayload) {
+	keepAlive(payload, payload.liveValues())
+}
+
+// keepAlive holds values alive in a finalizer closure for as long as
+// payload is reachable. It's safe to call concurrently on the same
+// payload: runtime.SetFinalizer panics if a finalizer is already set, so
+// clearing the previous one and installing the new one is serialized under
+// payload.pinMu to prevent two callers' clear/set pairs from interleaving.
+func keepAlive(payload *magicStringPayload, values []interface{}) {
+	payload.pinMu.Lock()
+	defer payload.pinMu.Unlock()
+
+	runtime.SetFinalizer(payload, nil)
+	runtime.SetFinalizer(payload, func(payload *magicStringPayload) {
+		values = nil
+	})
+}
@@ -0,0 +1,95 @@
+// Copyright 2022 Huan Du. All rights reserved.
+// Licensed under the MIT license that can be found in the LICENSE file.
+
+package magicstring
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/huandu/go-assert"
+)
+
+type keyA struct{}
+type keyB struct{}
+
+func TestAttachReadKey(t *testing.T) {
+	a := assert.New(t)
+
+	iterateStrings(func(s string) {
+		attached := AttachKey(s, keyA{}, 1)
+		a.Equal(s, attached)
+
+		// A second subsystem attaching its own key must not clobber keyA.
+		attached2 := AttachKey(attached, keyB{}, "foo")
+		a.Equal(attached, attached2)
+
+		v, ok := ReadKey(attached2, keyA{})
+		a.Assert(ok)
+		a.Equal(v, 1)
+
+		v, ok = ReadKey(attached2, keyB{})
+		a.Assert(ok)
+		a.Equal(v, "foo")
+
+		_, ok = ReadKey(attached2, "missing")
+		a.Assert(!ok)
+	})
+}
+
+func TestAttachKeyDoesNotDisturbData(t *testing.T) {
+	a := assert.New(t)
+	s := "sample string"
+
+	attached := Attach(s, 123)
+	withKey := AttachKey(attached, keyA{}, "foo")
+	a.Equal(attached, withKey)
+	a.Equal(Read(withKey), 123)
+
+	v, ok := ReadKey(withKey, keyA{})
+	a.Assert(ok)
+	a.Equal(v, "foo")
+}
+
+func TestKeysOverflowIntoSpillMap(t *testing.T) {
+	a := assert.New(t)
+	s := "sample string"
+	attached := s
+
+	n := maxInlineKeyedData + 3
+
+	for i := 0; i < n; i++ {
+		attached = AttachKey(attached, i, i)
+	}
+
+	keys := Keys(attached)
+	a.Equal(len(keys), n)
+
+	got := make([]int, 0, n)
+	for _, k := range keys {
+		got = append(got, k.(int))
+	}
+	sort.Ints(got)
+
+	for i := 0; i < n; i++ {
+		a.Equal(got[i], i)
+
+		v, ok := ReadKey(attached, i)
+		a.Assert(ok)
+		a.Equal(v, i)
+	}
+}
+
+func TestDeleteKey(t *testing.T) {
+	a := assert.New(t)
+	s := "sample string"
+
+	a.Assert(!DeleteKey(s, keyA{}))
+
+	attached := AttachKey(s, keyA{}, 1)
+	a.Assert(DeleteKey(attached, keyA{}))
+	a.Assert(!DeleteKey(attached, keyA{}))
+
+	_, ok := ReadKey(attached, keyA{})
+	a.Assert(!ok)
+}
@@ -0,0 +1,137 @@
+// Copyright 2022 Huan Du. All rights reserved.
+// Licensed under the MIT license that can be found in the LICENSE file.
+
+package magicbytes
+
+import (
+	"reflect"
+	"unsafe"
+)
+
+// AttachBytes associates a newly allocated []byte with data.
+// The content of the returned slice is guaranteed to be identical to b, and
+// its len is always equal to its cap, so any append to it copies the
+// backing array instead of growing in place, silently dropping data.
+//
+// A nil data is a kind of data: AttachBytes(b, nil) still returns magic
+// bytes, for which IsBytes reports true. Use DetachBytes to strip an
+// attachment.
+func AttachBytes(b []byte, data interface{}) []byte {
+	sz := len(b)
+
+	if sz == 0 {
+		return attachEmptyBytes(data)
+	}
+
+	if sz <= smallBytesMax {
+		return attachSmallBytes(b, data)
+	}
+
+	return attachLargeBytes(b, data)
+}
+
+// attachEmptyBytes allocates a new holder for an empty []byte.
+func attachEmptyBytes(data interface{}) []byte {
+	payload := &magicBytesPayload{}
+	payload.checksum = makeChecksum(uintptr(unsafe.Pointer(payload)))
+	payload.data = data
+	return (*[sizeofPayload]byte)(unsafe.Pointer(payload))[0:0:0]
+}
+
+// attachSmallBytes allocates a new holder type to hold both the []byte
+// content and data.
+func attachSmallBytes(b []byte, data interface{}) []byte {
+	sz := len(b)
+	payload, dst := newPayload(sz)
+	copy(dst, b)
+	payload.checksum = makeChecksum(uintptr(unsafe.Pointer(&dst[0])))
+	payload.data = data
+	return dst
+}
+
+// attachLargeBytes allocates new memory to hold both the []byte content and
+// the magic bytes payload. The data is referenced by the slice's finalizer.
+func attachLargeBytes(b []byte, data interface{}) []byte {
+	holder := make([]byte, len(b)+int(sizeofPayload))
+	payload := (*magicBytesPayload)(unsafe.Pointer(&holder[0]))
+	dst := holder[sizeofPayload:]
+
+	payload.checksum = makeChecksum(uintptr(unsafe.Pointer(&dst[0])))
+	payload.data = data
+	copy(dst, b)
+
+	pin(payload, data)
+	return dst
+}
+
+// ReadBytes reads the data attached inside b.
+// If there is no such data, it returns nil.
+func ReadBytes(b []byte) interface{} {
+	payload := read(b)
+
+	if payload == nil {
+		return nil
+	}
+
+	return payload.data
+}
+
+// IsBytes checks if there is any data attached to b.
+func IsBytes(b []byte) bool {
+	payload := read(b)
+	return payload != nil
+}
+
+// ReplaceBytes replaces the data attached to b with data.
+// It reports whether b was magic bytes; if not, nothing happens.
+func ReplaceBytes(b []byte, data interface{}) bool {
+	payload := read(b)
+
+	if payload == nil {
+		return false
+	}
+
+	payload.data = data
+	pin(payload, data)
+	return true
+}
+
+func read(b []byte) (payload *magicBytesPayload) {
+	header := (*reflect.SliceHeader)(unsafe.Pointer(&b))
+
+	if header.Data == 0 || header.Len != header.Cap {
+		return
+	}
+
+	data := unsafe.Pointer(header.Data)
+	checksum := makeChecksum(uintptr(data))
+
+	if header.Len == 0 {
+		payload = (*magicBytesPayload)(data)
+	} else {
+		payload = (*magicBytesPayload)(unsafe.Pointer(uintptr(data) - sizeofPayload))
+	}
+
+	if payload.checksum != checksum {
+		payload = nil
+		return
+	}
+
+	return
+}
+
+// DetachBytes returns a new []byte without any attached data.
+// If b is an ordinary []byte, DetachBytes just simply returns b.
+func DetachBytes(b []byte) []byte {
+	if !IsBytes(b) {
+		return b
+	}
+
+	if len(b) == 0 {
+		return []byte{}
+	}
+
+	dst := make([]byte, len(b))
+	copy(dst, b)
+	return dst
+}
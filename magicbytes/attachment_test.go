@@ -0,0 +1,85 @@
+// Copyright 2022 Huan Du. All rights reserved.
+// Licensed under the MIT license that can be found in the LICENSE file.
+
+package magicbytes
+
+import (
+	"reflect"
+	"testing"
+	"unsafe"
+
+	"github.com/huandu/go-assert"
+)
+
+func TestAttachBytesData(t *testing.T) {
+	a := assert.New(t)
+	cases := []interface{}{
+		1, "abcd", true, 1.2, &testStruct{Foo: 123},
+		map[string][]int{"foo": {1, 2, 3}},
+	}
+
+	for _, c := range cases {
+		iterateByteSlices(func(b []byte) {
+			copied := AttachBytes(b, c)
+			a.Equal(copied, b)
+			a.Assert(IsBytes(copied))
+			a.Equal(ReadBytes(copied), c)
+		})
+	}
+}
+
+func TestAttachBytesNilData(t *testing.T) {
+	a := assert.New(t)
+	b1 := []byte("nil data")
+	b2 := AttachBytes(b1, nil)
+
+	// Nil data is a kind of data, same as Attach for strings.
+	a.Assert(IsBytes(b2))
+
+	// The buffer in b1 and b2 must be different.
+	data1 := (*reflect.SliceHeader)(unsafe.Pointer(&b1)).Data
+	data2 := (*reflect.SliceHeader)(unsafe.Pointer(&b2)).Data
+	a.NotEqual(data1, data2)
+}
+
+func TestReadInvalidBytes(t *testing.T) {
+	a := assert.New(t)
+	b := []byte("dummy")
+	a.Assert(!IsBytes(b))
+	a.Assert(ReadBytes(b) == nil)
+}
+
+func TestAppendDropsAttachment(t *testing.T) {
+	a := assert.New(t)
+	attached := AttachBytes([]byte("foo"), 123)
+	a.Assert(IsBytes(attached))
+
+	grown := append(attached, 'x')
+	a.Assert(!IsBytes(grown))
+}
+
+func TestReplaceBytes(t *testing.T) {
+	a := assert.New(t)
+
+	iterateByteSlices(func(b []byte) {
+		ok := ReplaceBytes(b, 123)
+		a.Assert(!ok)
+
+		attached := AttachBytes(b, 123)
+		ok = ReplaceBytes(attached, "foo")
+		a.Assert(ok)
+		a.Equal(ReadBytes(attached), "foo")
+	})
+}
+
+func TestDetachBytes(t *testing.T) {
+	a := assert.New(t)
+
+	iterateByteSlices(func(b []byte) {
+		attached := AttachBytes(b, &testStruct{Foo: 398})
+		detached := DetachBytes(attached)
+		a.Equal(detached, b)
+		a.Assert(IsBytes(attached))
+		a.Assert(!IsBytes(detached))
+	})
+}
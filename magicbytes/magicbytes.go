@@ -0,0 +1,121 @@
+// Copyright 2022 Huan Du. All rights reserved.
+// Licensed under the MIT license that can be found in the LICENSE file.
+
+// Package magicbytes is the `[]byte` sibling of `magicstring`: it attaches
+// arbitrary data to a `[]byte` and reads the data back later, using the
+// same size-class-based holder trick. A `[]byte` with attached data is
+// called a "magic bytes" here.
+//
+// Unlike a string, a []byte is mutable and growable, so the attachment is
+// only as durable as the slice header: any `append` that needs to grow the
+// backing array allocates a fresh one and silently drops the attachment,
+// the same way Detach does for strings.
+package magicbytes
+
+import (
+	"math"
+	"reflect"
+	"runtime"
+	"sort"
+	"sync"
+	"unsafe"
+)
+
+const (
+	sizeofPayload     = unsafe.Sizeof(magicBytesPayload{})
+	sizeofSizeClasses = unsafe.Sizeof(runtime.MemStats{}.BySize) / unsafe.Sizeof(runtime.MemStats{}.BySize[0])
+)
+
+// magicBytesPayload is the payload holding extra data.
+type magicBytesPayload struct {
+	checksum uint64
+	data     interface{}
+
+	// pinMu serializes (re-)installing the finalizer that keeps a large
+	// []byte's attached data reachable to the garbage collector, so
+	// concurrent callers can't interleave their clear-then-set of
+	// runtime.SetFinalizer and trip its "finalizer already set" panic.
+	pinMu sync.Mutex
+}
+
+// pin (re-)installs a finalizer on payload that keeps data reachable to the
+// garbage collector. This is required because a large magic []byte's
+// payload is carved out of a raw []byte, which the garbage collector does
+// not scan for pointers, so nothing would otherwise keep an attached
+// reference type alive.
+func pin(payload *magicBytesPayload, data interface{}) {
+	payload.pinMu.Lock()
+	defer payload.pinMu.Unlock()
+
+	runtime.SetFinalizer(payload, nil)
+	runtime.SetFinalizer(payload, func(payload *magicBytesPayload) {
+		// Hold data in this finalizer and clear it after finalized.
+		data = nil
+	})
+}
+
+var (
+	typeofMagicBytesPayload = reflect.TypeOf(magicBytesPayload{})
+	typeofByte              = reflect.TypeOf(byte(0))
+
+	holderWithSizeClasses []int
+	holderTypes           []reflect.Type
+	smallBytesMax         int
+)
+
+func init() {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+
+	holderWithSizeClasses = make([]int, 0, sizeofSizeClasses)
+	holderTypes = make([]reflect.Type, 0, sizeofSizeClasses)
+
+	// Create struct types which perfectly fit a size class.
+	for i := 0; i < int(sizeofSizeClasses); i++ {
+		size := int(stats.BySize[i].Size)
+
+		if size <= int(sizeofPayload) {
+			continue
+		}
+
+		diff := size - int(sizeofPayload)
+		t := reflect.StructOf([]reflect.StructField{
+			{
+				Name: "Payload",
+				Type: typeofMagicBytesPayload,
+			},
+			{
+				Name: "Data",
+				Type: reflect.ArrayOf(diff, typeofByte),
+			},
+		})
+		holderWithSizeClasses = append(holderWithSizeClasses, diff)
+		holderTypes = append(holderTypes, t)
+	}
+
+	// As sizes in runtime.MemStats.BySize is sorted by Size,
+	// max size of a small []byte is the last of the slice.
+	smallBytesMax = holderWithSizeClasses[len(holderWithSizeClasses)-1]
+}
+
+// newPayload allocates a payload struct with enough space.
+func newPayload(size int) (payload *magicBytesPayload, dst []byte) {
+	idx := sort.SearchInts(holderWithSizeClasses, size)
+	sz := holderWithSizeClasses[idx] + int(sizeofPayload)
+	t := holderTypes[idx]
+	v := reflect.New(t)
+	data := (*[math.MaxInt32]byte)(unsafe.Pointer(v.Pointer()))[:sz:sz]
+	payload = (*magicBytesPayload)(unsafe.Pointer(&data[0]))
+	dst = data[sizeofPayload : int(sizeofPayload)+size : int(sizeofPayload)+size]
+	return
+}
+
+var (
+	checksumMask uint64 = 0xcfb6b2da518bead
+)
+
+// makeChecksum calculates a checksum for ptr.
+// This checksum will be checked when decoding.
+func makeChecksum(ptr uintptr) uint64 {
+	return uint64(ptr) ^ checksumMask
+}
@@ -0,0 +1,29 @@
+// Copyright 2022 Huan Du. All rights reserved.
+// Licensed under the MIT license that can be found in the LICENSE file.
+
+package magicbytes
+
+var testByteSlices = [][]byte{
+	{}, {1}, makeBytes(3), makeBytes(7), makeBytes(8),
+	makeBytes(9),
+	makeBytes(16),
+	makeBytes(31),
+	makeBytes(65),
+	makeBytes(31293),
+	makeBytes(129485),
+	makeBytes(1_000_000),
+}
+
+type testStruct struct {
+	Foo int
+}
+
+func makeBytes(size int) []byte {
+	return make([]byte, size)
+}
+
+func iterateByteSlices(fn func(b []byte)) {
+	for _, b := range testByteSlices {
+		fn(b)
+	}
+}
@@ -11,6 +11,8 @@ import (
 	"reflect"
 	"runtime"
 	"sort"
+	"sync"
+	"sync/atomic"
 	"unsafe"
 )
 
@@ -19,10 +21,67 @@ const (
 	sizeofSizeClasses = unsafe.Sizeof(runtime.MemStats{}.BySize) / unsafe.Sizeof(runtime.MemStats{}.BySize[0])
 )
 
+// maxInlineKeyedData is the number of AttachKey entries a keyedStore can
+// hold inline before it spills into kvExtra.
+const maxInlineKeyedData = 4
+
+// keyedData is one key/data pair attached through AttachKey.
+type keyedData struct {
+	key  interface{}
+	data interface{}
+}
+
+// keyedStore holds the data AttachKey attaches to a payload. It's kept
+// behind a pointer on magicStringPayload and allocated on first use, so
+// the overwhelming majority of magic strings created through plain Attach,
+// which never touch AttachKey, don't pay for it.
+type keyedStore struct {
+	// kv and kvLen hold the fast path for AttachKey: a handful of
+	// independent subsystems can each keep their own entry without
+	// allocating a map. Once kv is full, further keys spill into kvExtra.
+	kv      [maxInlineKeyedData]keyedData
+	kvLen   int
+	kvExtra map[interface{}]interface{}
+}
+
 // magicStringPayload is the payload holding extra data.
 type magicStringPayload struct {
 	checksum uint64
-	data     interface{}
+
+	// data is behind an atomic.Pointer so Read can run concurrently with
+	// Replace/CompareAndSwap/Swap without racing on the interface{} word.
+	data atomic.Pointer[interface{}]
+
+	// keyStore is nil until the first AttachKey call allocates it.
+	keyStore *keyedStore
+
+	// pinMu serializes (re-)installing the finalizer that keeps a large
+	// string's attached values reachable to the garbage collector, so
+	// concurrent callers of pin can't interleave their clear-then-set of
+	// runtime.SetFinalizer and trip its "finalizer already set" panic.
+	pinMu sync.Mutex
+}
+
+// loadData reads the value currently stored in p.data, if any.
+func (p *magicStringPayload) loadData() interface{} {
+	v := p.data.Load()
+
+	if v == nil {
+		return nil
+	}
+
+	return *v
+}
+
+// storeData stores data in p.data, boxing it so atomic.Pointer can swap it
+// as a single word.
+func (p *magicStringPayload) storeData(data interface{}) {
+	if data == nil {
+		p.data.Store(nil)
+		return
+	}
+
+	p.data.Store(&data)
 }
 
 var (
@@ -64,6 +64,32 @@ func TestGCSafety(t *testing.T) {
 	})
 }
 
+// TestGCSafetyLargeStringWithChurn guards against a large string's boxed
+// *interface{} being collected out from under it: TestGCSafety's brief,
+// churn-free GC pauses are too quiet to force the allocator to actually
+// reuse a reclaimed box, so a bug here can slip through it undetected.
+func TestGCSafetyLargeStringWithChurn(t *testing.T) {
+	a := assert.New(t)
+	str := makeString(1_000_000)
+
+	for i := 0; i < 50; i++ {
+		data := &testStruct{Foo: i}
+		attached := Attach(str, data)
+
+		// Churn the heap so the allocator has real garbage to reclaim and
+		// reuse, instead of merely running a GC cycle over a quiet heap.
+		for j := 0; j < 1000; j++ {
+			_ = make([]byte, 4096)
+		}
+
+		runtime.GC()
+		runtime.GC()
+
+		payload := Read(attached)
+		a.Equal(payload, data)
+	}
+}
+
 func BenchmarkAttachSmallString(b *testing.B) {
 	s := "small"
 	data := map[string]int{
@@ -0,0 +1,104 @@
+// Copyright 2022 Huan Du. All rights reserved.
+// Licensed under the MIT license that can be found in the LICENSE file.
+
+package magicstring
+
+// Replace replaces the data attached to str with data.
+// It reports whether str was a magic string; if not, nothing happens.
+//
+// Replace is safe to call concurrently with Read, CompareAndSwap, Swap and
+// other calls to Replace on the same str.
+func Replace(str string, data interface{}) bool {
+	payload := read(str)
+
+	if payload == nil {
+		return false
+	}
+
+	payload.storeData(data)
+	pin(payload)
+	return true
+}
+
+// CompareAndSwap replaces the data attached to str with new, but only if
+// the data currently attached to it is equal to old. It reports whether the
+// swap happened.
+//
+// Attach accepts uncomparable data, such as a map or slice, which old can
+// never equal: in that case CompareAndSwap always reports false instead of
+// panicking, the same way current != old would panic if attempted
+// directly.
+//
+// Like Replace, CompareAndSwap is safe to call concurrently with Read and
+// other calls to Replace/CompareAndSwap/Swap on the same str.
+func CompareAndSwap(str string, old, new interface{}) bool {
+	payload := read(str)
+
+	if payload == nil {
+		return false
+	}
+
+	for {
+		oldPtr := payload.data.Load()
+		var current interface{}
+
+		if oldPtr != nil {
+			current = *oldPtr
+		}
+
+		if !equalData(current, old) {
+			return false
+		}
+
+		var newPtr *interface{}
+
+		if new != nil {
+			newPtr = &new
+		}
+
+		if payload.data.CompareAndSwap(oldPtr, newPtr) {
+			pin(payload)
+			return true
+		}
+	}
+}
+
+// Swap replaces the data attached to str with new and returns the data it
+// replaced. It reports ok == false if str is not a magic string, in which
+// case old is always nil.
+func Swap(str string, new interface{}) (old interface{}, ok bool) {
+	payload := read(str)
+
+	if payload == nil {
+		return nil, false
+	}
+
+	var newPtr *interface{}
+
+	if new != nil {
+		newPtr = &new
+	}
+
+	oldPtr := payload.data.Swap(newPtr)
+	pin(payload)
+
+	if oldPtr != nil {
+		old = *oldPtr
+	}
+
+	return old, true
+}
+
+// equalData reports whether a and b are equal, the way CompareAndSwap needs
+// to compare the data Attach accepted. a == b panics if a or b holds an
+// uncomparable dynamic type, such as a map or slice; since neither can ever
+// equal the other, equalData recovers from that panic and reports false.
+func equalData(a, b interface{}) (eq bool) {
+	defer func() {
+		if recover() != nil {
+			eq = false
+		}
+	}()
+
+	return a == b
+}
@@ -0,0 +1,83 @@
+// Copyright 2022 Huan Du. All rights reserved.
+// Licensed under the MIT license that can be found in the LICENSE file.
+
+package magicstring
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/huandu/go-assert"
+)
+
+func TestCompareAndSwap(t *testing.T) {
+	a := assert.New(t)
+	s := "sample string"
+
+	a.Assert(!CompareAndSwap(s, nil, 1))
+
+	attached := Attach(s, 1)
+	a.Assert(!CompareAndSwap(attached, 2, 3))
+	a.Equal(Read(attached), 1)
+
+	a.Assert(CompareAndSwap(attached, 1, 2))
+	a.Equal(Read(attached), 2)
+}
+
+// TestCompareAndSwapUncomparableOld makes sure an uncomparable old, which
+// Attach happily accepts as data but which can never equal anything via ==,
+// makes CompareAndSwap report false instead of panicking.
+func TestCompareAndSwapUncomparableOld(t *testing.T) {
+	a := assert.New(t)
+	data := map[string]int{"foo": 1}
+	attached := Attach("sample string", data)
+
+	a.Assert(!CompareAndSwap(attached, data, 1))
+	a.Equal(Read(attached), data)
+
+	a.Assert(!CompareAndSwap(attached, []int{1, 2, 3}, 1))
+	a.Equal(Read(attached), data)
+}
+
+func TestSwap(t *testing.T) {
+	a := assert.New(t)
+	s := "sample string"
+
+	old, ok := Swap(s, 1)
+	a.Assert(!ok)
+	a.Assert(old == nil)
+
+	attached := Attach(s, 1)
+	old, ok = Swap(attached, 2)
+	a.Assert(ok)
+	a.Equal(old, 1)
+	a.Equal(Read(attached), 2)
+}
+
+func TestReplaceConcurrent(t *testing.T) {
+	a := assert.New(t)
+	attached := Attach("sample string", 0)
+
+	var wg sync.WaitGroup
+
+	for i := 1; i <= 100; i++ {
+		wg.Add(1)
+		go func(v int) {
+			defer wg.Done()
+			Replace(attached, v)
+		}(i)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 1000; i++ {
+			Read(attached)
+		}
+		close(done)
+	}()
+
+	wg.Wait()
+	<-done
+
+	a.Assert(Is(attached))
+}
@@ -0,0 +1,38 @@
+// Copyright 2022 Huan Du. All rights reserved.
+// Licensed under the MIT license that can be found in the LICENSE file.
+
+package magicstring
+
+// AttachT is a generic counterpart of Attach. It stores v in str exactly
+// the way Attach does; ReadT then hands v back as a T, so callers need no
+// interface{} type assertion of their own.
+func AttachT[T any](str string, v T) string {
+	return Attach(str, v)
+}
+
+// ReadT is a generic counterpart of Read. It returns the zero value of T
+// and ok == false if str is not a magic string or the value attached to it
+// is not of type T.
+func ReadT[T any](str string) (v T, ok bool) {
+	data := Read(str)
+
+	if data == nil {
+		return
+	}
+
+	v, ok = data.(T)
+
+	if !ok {
+		var zero T
+		return zero, false
+	}
+
+	return v, true
+}
+
+// ReplaceT is a generic counterpart of Replace. It reports whether str was
+// a magic string, in which case the value attached to it is replaced by v
+// regardless of the type previously stored there.
+func ReplaceT[T any](str string, v T) bool {
+	return Replace(str, v)
+}
@@ -0,0 +1,72 @@
+// Copyright 2022 Huan Du. All rights reserved.
+// Licensed under the MIT license that can be found in the LICENSE file.
+
+package magicstring
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/huandu/go-assert"
+)
+
+func TestAttachReadT(t *testing.T) {
+	a := assert.New(t)
+
+	iterateStrings(func(s string) {
+		attached := AttachT(s, 123)
+		a.Equal(s, attached)
+
+		v, ok := ReadT[int](attached)
+		a.Assert(ok)
+		a.Equal(v, 123)
+
+		// Reading with the wrong type must fail without panicking.
+		sv, ok := ReadT[string](attached)
+		a.Assert(!ok)
+		a.Equal(sv, "")
+	})
+}
+
+func TestReadTNotMagicString(t *testing.T) {
+	a := assert.New(t)
+	v, ok := ReadT[int]("dummy")
+	a.Assert(!ok)
+	a.Equal(v, 0)
+}
+
+func TestReplaceT(t *testing.T) {
+	a := assert.New(t)
+	s := "sample string"
+
+	ok := ReplaceT(s, 123)
+	a.Assert(!ok)
+
+	attached := AttachT(s, 123)
+	ok = ReplaceT(attached, "foo")
+	a.Assert(ok)
+
+	v, ok := ReadT[string](attached)
+	a.Assert(ok)
+	a.Equal(v, "foo")
+}
+
+func ExampleAttachT() {
+	type T struct {
+		Name string
+	}
+
+	s1 := "Hello, world!"
+	data := T{Name: "Kanon"}
+	s2 := AttachT(s1, data)
+
+	attached, ok := ReadT[T](s2)
+	fmt.Println(s1 == s2)
+	fmt.Println(ok)
+	fmt.Println(attached == data)
+
+	// Output:
+	// true
+	// true
+	// true
+}